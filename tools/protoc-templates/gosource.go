@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"strings"
+
+	"golang.org/x/tools/imports"
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+const (
+	// snippetContextLines is the number of lines shown around a syntax error.
+	snippetContextLines = 3
+)
+
+// checkGoSource returns an error showing the offending snippet, with line numbers, if the generated source does not
+// parse. protogen formats the source once it parses.
+func checkGoSource(filename string, source []byte) error {
+	_, err := parser.ParseFile(token.NewFileSet(), filename, source, parser.ParseComments)
+	if err == nil {
+		return nil
+	}
+	var errorList scanner.ErrorList
+	if !errors.As(err, &errorList) || len(errorList) == 0 {
+		return fmt.Errorf("parsing generated %s: %w", filename, err)
+	}
+	firstError := errorList[0]
+	lines := strings.Split(string(source), "\n")
+	start := max(firstError.Pos.Line-snippetContextLines, 1)
+	end := min(firstError.Pos.Line+snippetContextLines, len(lines))
+	var snippet strings.Builder
+	for line := start; line <= end; line++ {
+		marker := " "
+		if line == firstError.Pos.Line {
+			marker = ">"
+		}
+		fmt.Fprintf(&snippet, "%s%5d\t%s\n", marker, line, lines[line-1])
+	}
+	return fmt.Errorf("generated %s is not valid Go (%d error(s)): %v\n%s", filename, len(errorList), firstError, snippet.String())
+}
+
+// fixImports replaces the generated file with a copy whose imports are fixed by goimports.
+func fixImports(gen *protogen.Plugin, generatedFile *protogen.GeneratedFile, filename string) error {
+	content, err := generatedFile.Content()
+	if err != nil {
+		return err
+	}
+	fixedContent, err := imports.Process(filename, content, &imports.Options{Comments: true, TabIndent: true, TabWidth: 8})
+	if err != nil {
+		return fmt.Errorf("fixing imports of %s: %w", filename, err)
+	}
+	generatedFile.Skip()
+	_, err = gen.NewGeneratedFile(filename, "").Write(fixedContent)
+	return err
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
 	"flag"
 	"fmt"
 	"os"
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/Masterminds/sprig/v3"
 	"google.golang.org/protobuf/compiler/protogen"
 	"google.golang.org/protobuf/types/pluginpb"
 
@@ -16,59 +17,120 @@ import (
 	_ "github.com/malonaz/core/genproto/codegen/gateway"
 	_ "github.com/malonaz/core/genproto/codegen/model"
 	_ "github.com/malonaz/core/genproto/codegen/rpc"
+
+	"github.com/malonaz/malonaz/tools/validate-schema/schema"
 )
 
 var (
 	opts struct {
-		Debug         *bool
-		Template      *string
-		Configuration *string
+		Debug               *bool
+		Templates           stringList
+		Includes            stringList
+		Mode                *string
+		Annotation          *string
+		Filename            *string
+		Configuration       *string
+		ConfigurationSchema *string
+		Goimports           *bool
 	}
 )
 
+// stringList is a flag that can be repeated, accumulating its values.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
 type Input struct {
 	File          *protogen.File
 	Files         []*protogen.File
 	GeneratedFile *protogen.GeneratedFile
-	Configuration map[any]any
+	Configuration map[string]any
+	// Set in service mode.
+	Service *protogen.Service
+	// Set in message mode.
+	Message *protogen.Message
+}
+
+// FilenameInput is the data of the filename template.
+type FilenameInput struct {
+	File *protogen.File
+	// Set in service mode.
+	Service *protogen.Service
+	// Set in message mode.
+	Message *protogen.Message
+	// Template is the filename of the template, without its extension.
+	Template string
 }
 
+// defaultFilename is the default filename template. The name of the service or message is appended in service and
+// message mode.
+const defaultFilename = "{{ .File.GeneratedFilenamePrefix }}_{{ .Template }}" +
+	"{{ with .Service }}_{{ .GoName | snakecase }}{{ end }}" +
+	"{{ with .Message }}_{{ .GoIdent.GoName | snakecase }}{{ end }}" +
+	".pb.go"
+
 func main() {
 	var flags flag.FlagSet
 	opts.Debug = flags.Bool("debug", false, "verbose output")
-	opts.Template = flags.String("template", "", "template file to compile")
-	opts.Configuration = flags.String("configuration", "", "configuration to inject in context")
+	flags.Var(&opts.Templates, "template", "template file to compile, or directory of .tmpl files (can be repeated)")
+	flags.Var(&opts.Includes, "include", "template file, or directory of .tmpl files, defining helper templates available to every template (can be repeated)")
+	opts.Mode = flags.String("mode", modeFile, "generate one output per file, service or message")
+	opts.Annotation = flags.String("annotation", "", "in service or message mode, full name of the extension that the options of a service or message must set for it to be generated")
+	opts.Filename = flags.String("filename", defaultFilename, "template of the output filenames, which cannot contain commas")
+	opts.Configuration = flags.String("configuration", "", "configuration to inject in context (json, or yaml with a .yaml/.yml extension)")
+	opts.ConfigurationSchema = flags.String("configuration_schema", "", "JSON schema that the configuration must satisfy")
+	opts.Goimports = flags.Bool("goimports", false, "fix the imports of the generated .go files with goimports")
 	options := protogen.Options{
 		ParamFunc: flags.Set,
 	}
 	options.Run(func(gen *protogen.Plugin) error {
 		*opts.Debug = false
-		if *opts.Template == "" {
+		if len(opts.Templates) == 0 {
 			return fmt.Errorf("template parameter is required")
 		}
+		templatePaths, err := expandTemplatePaths(opts.Templates)
+		if err != nil {
+			return err
+		}
+		filenameTmpl, err := template.New("filename").Funcs(sprig.TxtFuncMap()).Parse(*opts.Filename)
+		if err != nil {
+			return fmt.Errorf("parsing filename template: %w", err)
+		}
+		includePaths, err := expandTemplatePaths(opts.Includes)
+		if err != nil {
+			return err
+		}
+		includePathToContent := make(map[string]string, len(includePaths))
+		for _, includePath := range includePaths {
+			if includePathToContent[includePath], err = readTemplateContent(includePath); err != nil {
+				return fmt.Errorf("reading include %s: %w", includePath, err)
+			}
+		}
 
-		var configuration map[any]any
+		var configuration map[string]any
 		if *opts.Configuration != "" {
 			configData, err := os.ReadFile(*opts.Configuration)
 			if err != nil {
 				return fmt.Errorf("reading configuration file: %w", err)
 			}
 
-			if err := json.Unmarshal(configData, &configuration); err != nil {
+			format := "json"
+			if extension := filepath.Ext(*opts.Configuration); extension == ".yaml" || extension == ".yml" {
+				format = "yaml"
+			}
+			if configuration, err = schema.Unmarshal(configData, format); err != nil {
 				return fmt.Errorf("parsing configuration file: %w", err)
 			}
+			if *opts.ConfigurationSchema != "" {
+				if err := schema.Validate(*opts.ConfigurationSchema, configuration); err != nil {
+					return fmt.Errorf("validating configuration file: %w", err)
+				}
+			}
+		} else if *opts.ConfigurationSchema != "" {
+			return fmt.Errorf("configuration_schema parameter requires a configuration")
 		}
 
-		// Read template content (but don't parse yet)
-		templateContent, err := readTemplateContent(*opts.Template)
-		if err != nil {
-			return fmt.Errorf("reading template %s: %w", *opts.Template, err)
-		}
-
-		// Get template name for output filename
-		templateFilename := filepath.Base(*opts.Template)
-		templateFilenameWithoutExtension := strings.TrimSuffix(templateFilename, filepath.Ext(templateFilename))
-
 		// Let's grab other files.
 		otherFiles := []*protogen.File{}
 		for _, f := range gen.Files {
@@ -77,32 +139,78 @@ func main() {
 			}
 		}
 
-		for _, f := range gen.Files {
-			if !f.Generate {
-				continue
-			}
-			generatedFilename := fmt.Sprintf(
-				"%s_%s.pb.go", f.GeneratedFilenamePrefix, templateFilenameWithoutExtension,
-			)
-			generatedFile := gen.NewGeneratedFile(generatedFilename, "")
-			scopedExecution := newScopedExecution(generatedFile)
-
-			// Create template with custom functions first, then parse
-			tmpl, err := template.New(templateFilename).
-				Funcs(scopedExecution.FuncMap()).
-				Parse(templateContent)
+		for _, templatePath := range templatePaths {
+			// Read template content (but don't parse yet)
+			templateContent, err := readTemplateContent(templatePath)
 			if err != nil {
-				return fmt.Errorf("parsing template with functions: %w", err)
+				return fmt.Errorf("reading template %s: %w", templatePath, err)
 			}
 
-			input := &Input{
-				File:          f,
-				Files:         otherFiles,
-				GeneratedFile: generatedFile,
-				Configuration: configuration,
-			}
-			if err := tmpl.Execute(generatedFile, input); err != nil {
-				return fmt.Errorf("executing template: %w", err)
+			// Get template name for output filename
+			templateFilename := filepath.Base(templatePath)
+			templateFilenameWithoutExtension := strings.TrimSuffix(templateFilename, filepath.Ext(templateFilename))
+
+			for _, f := range gen.Files {
+				if !f.Generate {
+					continue
+				}
+				targets, err := generationTargets(f, *opts.Mode, *opts.Annotation)
+				if err != nil {
+					return err
+				}
+				for _, target := range targets {
+					filenameInput := &FilenameInput{
+						File:     f,
+						Service:  target.service,
+						Message:  target.message,
+						Template: templateFilenameWithoutExtension,
+					}
+					var generatedFilename strings.Builder
+					if err := filenameTmpl.Execute(&generatedFilename, filenameInput); err != nil {
+						return fmt.Errorf("executing filename template: %w", err)
+					}
+					generatedFile := gen.NewGeneratedFile(generatedFilename.String(), "")
+					isGoFile := strings.HasSuffix(generatedFilename.String(), ".go")
+					scopedExecution := newScopedExecution(generatedFile)
+
+					// Create template with custom functions first, then parse the includes, so that the template can use
+					// and override the helpers they define.
+					tmpl := template.New(templateFilename).Funcs(scopedExecution.FuncMap())
+					for _, includePath := range includePaths {
+						if _, err := tmpl.New(includePath).Parse(includePathToContent[includePath]); err != nil {
+							return fmt.Errorf("parsing include %s: %w", includePath, err)
+						}
+					}
+					if _, err := tmpl.Parse(templateContent); err != nil {
+						return fmt.Errorf("parsing template %s with functions: %w", templatePath, err)
+					}
+
+					input := &Input{
+						File:          f,
+						Files:         otherFiles,
+						GeneratedFile: generatedFile,
+						Configuration: configuration,
+						Service:       target.service,
+						Message:       target.message,
+					}
+					var rendered bytes.Buffer
+					if err := tmpl.Execute(&rendered, input); err != nil {
+						return fmt.Errorf("executing template %s: %w", templatePath, err)
+					}
+					if isGoFile {
+						if err := checkGoSource(generatedFilename.String(), rendered.Bytes()); err != nil {
+							return fmt.Errorf("rendering template %s: %w", templatePath, err)
+						}
+					}
+					if _, err := generatedFile.Write(rendered.Bytes()); err != nil {
+						return err
+					}
+					if isGoFile && *opts.Goimports {
+						if err := fixImports(gen, generatedFile, generatedFilename.String()); err != nil {
+							return err
+						}
+					}
+				}
 			}
 		}
 		gen.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
@@ -110,6 +218,31 @@ func main() {
 	})
 }
 
+// expandTemplatePaths replaces each directory in the given paths with the .tmpl files it contains, in lexical order.
+func expandTemplatePaths(paths []string) ([]string, error) {
+	var templatePaths []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("template does not exist: %s", path)
+		}
+		if !info.IsDir() {
+			templatePaths = append(templatePaths, path)
+			continue
+		}
+		// Glob returns matches in lexical order.
+		matches, err := filepath.Glob(filepath.Join(path, "*.tmpl"))
+		if err != nil {
+			return nil, fmt.Errorf("listing templates of %s: %w", path, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no template found in %s", path)
+		}
+		templatePaths = append(templatePaths, matches...)
+	}
+	return templatePaths, nil
+}
+
 func readTemplateContent(templatePath string) (string, error) {
 	// Check if file exists
 	if _, err := os.Stat(templatePath); os.IsNotExist(err) {
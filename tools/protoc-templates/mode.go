@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// modeFile generates one output per file.
+	modeFile = "file"
+	// modeService generates one output per service, exposed to the template as .Service.
+	modeService = "service"
+	// modeMessage generates one output per top-level message, exposed to the template as .Message.
+	modeMessage = "message"
+)
+
+// generationTarget is an object of a file that a template generates an output for.
+type generationTarget struct {
+	service *protogen.Service
+	message *protogen.Message
+}
+
+// generationTargets returns the targets of the file according to the mode. In service and message mode, only the
+// services or messages whose options set the annotation extension are targeted, if an annotation is given.
+func generationTargets(f *protogen.File, mode, annotation string) ([]*generationTarget, error) {
+	var targets []*generationTarget
+	switch mode {
+	case modeFile:
+		return []*generationTarget{{}}, nil
+	case modeService:
+		for _, service := range f.Services {
+			ok, err := hasAnnotation(service.Desc, annotation)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				targets = append(targets, &generationTarget{service: service})
+			}
+		}
+	case modeMessage:
+		for _, message := range f.Messages {
+			ok, err := hasAnnotation(message.Desc, annotation)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				targets = append(targets, &generationTarget{message: message})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode %s, expected %s, %s or %s", mode, modeFile, modeService, modeMessage)
+	}
+	return targets, nil
+}
+
+// hasAnnotation returns true if the options of the descriptor set the extension with the given full name, or if no
+// extension is given.
+func hasAnnotation(desc protoreflect.Descriptor, fullName string) (bool, error) {
+	if fullName == "" {
+		return true, nil
+	}
+	extType, err := protoregistry.GlobalTypes.FindExtensionByName(protoreflect.FullName(fullName))
+	if err != nil {
+		return false, fmt.Errorf("failed to find extension %s: %w", fullName, err)
+	}
+	options := desc.Options()
+	if !options.ProtoReflect().IsValid() {
+		return false, nil
+	}
+	return proto.HasExtension(options, extType), nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// outputChecker compares rendered content against the existing output files.
+type outputChecker struct {
+	diffs []string
+}
+
+// check records a unified diff if the content of the file at the given path differs from the given content, or a
+// note if the file does not exist, whatever the content.
+func (c *outputChecker) check(path string, content []byte, _ fs.FileMode) error {
+	if path == stdioPath {
+		return fmt.Errorf("cannot check output written to stdout")
+	}
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		c.diffs = append(c.diffs, fmt.Sprintf("missing output %s\n", path))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(existing) == string(content) {
+		return nil
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(existing)),
+		B:        difflib.SplitLines(string(content)),
+		FromFile: path,
+		ToFile:   path + " (rendered)",
+		Context:  3,
+	})
+	if err != nil {
+		return fmt.Errorf("diffing %s: %w", path, err)
+	}
+	c.diffs = append(c.diffs, diff)
+	return nil
+}
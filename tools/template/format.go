@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/format"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// extensionToFormatter maps an output file extension to the formatter applied to it with --format.
+var extensionToFormatter = map[string]func([]byte) ([]byte, error){
+	".go":   format.Source,
+	".json": formatJSON,
+	".yaml": formatYAML,
+	".yml":  formatYAML,
+}
+
+// formatJSON indents every json value of the content with sorted keys, like `jq -S`. Numbers and html characters are
+// kept verbatim.
+func formatJSON(content []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	for {
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if err := encoder.Encode(value); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// formatYAML re-marshals every yaml document of the content with a consistent indentation.
+// Key order and comments are preserved.
+func formatYAML(content []byte) ([]byte, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for {
+		var node yaml.Node
+		if err := decoder.Decode(&node); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if err := encoder.Encode(&node); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestFormatJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"sorted keys", `{"b": 1, "a": {"d": [1, 2], "c": null}}`, "{\n  \"a\": {\n    \"c\": null,\n    \"d\": [\n      1,\n      2\n    ]\n  },\n  \"b\": 1\n}\n"},
+		{"numbers", `{"a": 12345678901234567890, "b": 1.50}`, "{\n  \"a\": 12345678901234567890,\n  \"b\": 1.50\n}\n"},
+		{"html characters", `{"a": "x < y && y > z"}`, "{\n  \"a\": \"x < y && y > z\"\n}\n"},
+		{"multiple values", "{\"a\": 1}\n{\"b\": 2}\n", "{\n  \"a\": 1\n}\n{\n  \"b\": 2\n}\n"},
+		{"empty", "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := formatJSON([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(actual) != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFormatJSONInvalid(t *testing.T) {
+	for _, input := range []string{`{"a": 1`, `{"a": 1} trailing`} {
+		if _, err := formatJSON([]byte(input)); err == nil {
+			t.Errorf("expected an error formatting %q", input)
+		}
+	}
+}
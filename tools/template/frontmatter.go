@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// frontMatterDelimiter opens and closes the front matter of a template.
+	frontMatterDelimiter = "---\n"
+)
+
+// frontMatter describes how a template is rendered. It is declared as a yaml block at the very top of a template:
+//
+//	---
+//	output: out/{{ .name }}.sh
+//	mode: "0755"
+//	strict: true
+//	---
+type frontMatter struct {
+	// Output is the template of the output path, executed with the data.
+	Output string `yaml:"output"`
+	// Mode is the permission mode of the output, in octal.
+	Mode string `yaml:"mode"`
+	// Strict makes the execution fail on missing keys.
+	Strict bool `yaml:"strict"`
+}
+
+// merge overrides the fields of the front matter with the fields set in the other front matter.
+func (f *frontMatter) merge(other *frontMatter) {
+	if other.Output != "" {
+		f.Output = other.Output
+	}
+	if other.Mode != "" {
+		f.Mode = other.Mode
+	}
+	f.Strict = f.Strict || other.Strict
+}
+
+// splitFrontMatter splits the front matter from the body of a template. A leading block that does not strictly decode
+// as a front matter (e.g. a yaml document separator followed by a document) is considered part of the body, in which
+// case a nil front matter is returned.
+func splitFrontMatter(content string) (*frontMatter, string) {
+	rest, ok := strings.CutPrefix(content, frontMatterDelimiter)
+	if !ok {
+		return nil, content
+	}
+	block, body, ok := strings.Cut(rest, "\n"+frontMatterDelimiter)
+	if !ok {
+		return nil, content
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(block))
+	decoder.KnownFields(true)
+	matter := &frontMatter{}
+	if err := decoder.Decode(matter); err != nil {
+		return nil, content
+	}
+	return matter, body
+}
@@ -1,91 +1,166 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
+	"os/exec"
+	"slices"
 	"strings"
 	"text/template"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
 var (
-	serviceRegex              = regexp.MustCompile(`service\s+([\w]+)\s+{`)
-	publisherRegex            = regexp.MustCompile(`require_nats_publishers:\s*\[([\s\S]*?)\]`)
-	filepathToContent         = map[string]string{}
-	filepathToGrpcServiceName = map[string]string{}
-	customFuncMap             = template.FuncMap{
+	// debugOutput is where the debug function prints.
+	debugOutput       io.Writer = os.Stdout
+	filepathToContent           = map[string]string{}
+	filepathToModTime           = map[string]time.Time{}
+	customFuncMap               = template.FuncMap{
 		"debug": func(v any) error {
-			fmt.Printf("%+v\n", v)
+			fmt.Fprintf(debugOutput, "%+v\n", v)
 			return nil
 		},
 
 		"readFile": readFile,
+		"exec":     execCommand,
 
-		"grpcSvcName": func(filepath string) (string, error) {
-			if serviceName, ok := filepathToGrpcServiceName[filepath]; ok {
-				return serviceName, nil
-			}
-			sanitizedFilepath := strings.TrimPrefix(filepath, "//")
-			sanitizedFilepath = strings.ReplaceAll(sanitizedFilepath, ":", "/")
-			content, err := readFile(sanitizedFilepath + ".proto")
-			if err != nil {
-				return "", err
-			}
+		"toToml":       toToml,
+		"fromToml":     fromToml,
+		"fromYamlFile": fromYamlFile,
+		"fromJsonFile": fromJsonFile,
+		"mergeDeep":    mergeDeep,
 
-			// Find the service definition
-			matches := serviceRegex.FindStringSubmatch(content)
-			if len(matches) != 2 {
-				return "", fmt.Errorf("no service found in %s", sanitizedFilepath)
-			}
+		"protoFile":          parseProtoFile,
+		"grpcSvcName":        grpcSvcName,
+		"grpcSvcNames":       grpcSvcNames,
+		"grpcNatsPublishers": grpcNatsPublishers,
+	}
+)
 
-			// Extract the service name
-			serviceName := matches[1]
-			if len(serviceName) == 0 {
-				return "", fmt.Errorf("empty service name found in %s", sanitizedFilepath)
-			}
-			filepathToGrpcServiceName[filepath] = serviceName
-			return serviceName, nil
-		},
+// execCommand runs a command and returns its stdout, without the trailing newlines.
+// Only commands allow-listed with --allow-exec can be run, and they are never run through a shell.
+func execCommand(name string, args ...string) (string, error) {
+	if !slices.Contains(opts.AllowExec, name) {
+		return "", fmt.Errorf("command %s is not allowed, see --allow-exec", name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.ExecTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running %s: %w: %s", strings.Join(cmd.Args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
 
-		"grpcNatsPublishers": func(filepath string) ([]string, error) {
-			sanitizedFilepath := strings.TrimPrefix(filepath, "//")
-			sanitizedFilepath = strings.ReplaceAll(sanitizedFilepath, ":", "/")
-			content, err := readFile(sanitizedFilepath + ".proto")
-			if err != nil {
-				return nil, err
-			}
+// toToml encodes the value as toml.
+func toToml(v any) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
 
-			// Find all matches
-			matches := publisherRegex.FindStringSubmatch(content)
-			if len(matches) != 2 {
-				return []string{}, nil // No publishers found
-			}
+// fromToml decodes a toml document.
+func fromToml(content string) (map[string]any, error) {
+	value := map[string]any{}
+	if err := toml.Unmarshal([]byte(content), &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// fromYamlFile decodes the yaml file at the given path.
+func fromYamlFile(filepath string) (any, error) {
+	content, err := readFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := yaml.Unmarshal([]byte(content), &value); err != nil {
+		return nil, fmt.Errorf("unmarshaling %s: %w", filepath, err)
+	}
+	return value, nil
+}
+
+// fromJsonFile decodes the json file at the given path.
+func fromJsonFile(filepath string) (any, error) {
+	content, err := readFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return nil, fmt.Errorf("unmarshaling %s: %w", filepath, err)
+	}
+	return value, nil
+}
 
-			// Split the publishers string and clean up each publisher
-			publishers := strings.Split(matches[1], ",")
-			var result []string
-			for _, publisher := range publishers {
-				// Clean up the string (remove quotes and whitespace)
-				publisher = strings.TrimSpace(publisher)
-				publisher = strings.Trim(publisher, `"'`)
-				if publisher != "" {
-					result = append(result, publisher)
-				}
+// mergeDeep returns a new object with the objects merged into it in order. Nested objects are merged recursively,
+// while any other value is replaced by the value of the last object that sets it. The arguments are not modified.
+func mergeDeep(objects ...map[string]any) map[string]any {
+	merged := map[string]any{}
+	for _, object := range objects {
+		for key, value := range object {
+			mergedObject, mergedIsObject := merged[key].(map[string]any)
+			valueObject, valueIsObject := value.(map[string]any)
+			if mergedIsObject && valueIsObject {
+				merged[key] = mergeDeep(mergedObject, valueObject)
+				continue
 			}
-			return result, nil
-		},
+			if valueIsObject {
+				value = mergeDeep(valueObject)
+			}
+			merged[key] = value
+		}
 	}
-)
+	return merged
+}
+
+// resetFileCaches drops the cached file contents, so that subsequent reads see changes on disk.
+func resetFileCaches() {
+	clear(filepathToContent)
+	clear(filepathToModTime)
+	clear(filepathToProtoFile)
+	clear(keyToParsedTemplates)
+}
+
+// invalidateStaleFiles drops the cached contents of the files that changed on disk since they were read.
+func invalidateStaleFiles() {
+	for filepath, modTime := range filepathToModTime {
+		if info, err := os.Stat(filepath); err == nil && info.ModTime().Equal(modTime) {
+			continue
+		}
+		delete(filepathToContent, filepath)
+		delete(filepathToModTime, filepath)
+		delete(filepathToProtoFile, filepath)
+	}
+}
 
 func readFile(filepath string) (string, error) {
 	if content, ok := filepathToContent[filepath]; ok {
 		return content, nil
 	}
+	info, err := os.Stat(filepath)
+	if err != nil {
+		return "", err
+	}
 	bytes, err := os.ReadFile(filepath)
 	if err != nil {
 		return "", err
 	}
 	content := string(bytes)
 	filepathToContent[filepath] = content
+	filepathToModTime[filepath] = info.ModTime()
 	return content, nil
 }
@@ -1,30 +1,104 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
+
+	"github.com/sirupsen/logrus"
 
-	"github.com/Masterminds/sprig/v3"
 	"github.com/malonaz/core/go/flags"
 	"github.com/malonaz/core/go/logging"
-	"gopkg.in/yaml.v3"
+)
+
+const (
+	// stdioPath is the path used to designate stdin/stdout.
+	stdioPath = "-"
 )
 
 var (
 	log = logging.NewPrettyLogger()
+	// outputFileMode is the default permission mode of the output files.
+	outputFileMode fs.FileMode
 )
 
-var opts struct {
-	Templates  []string `long:"template" description:"The template files to use" required:"true"`
-	Data       string   `long:"data" description:"The data file to use"`
-	DataFormat string   `long:"data-format" description:"The data format to use (json or yaml)" default:"json"`
-	Output     string   `long:"output" short:"o" description:"The output file to create" required:"true"`
-	Delims     string   `long:"delims" description:"Template delimiters format (e.g., '[[.]]' or '{{.}}')" default:"{{.}}"`
-	ExtraData  []string `long:"extra-data" description:"Extra data to pass in the format: key:value"`
+// options of the tool.
+type options struct {
+	Templates   []string `long:"template" description:"The template files to use (glob patterns are expanded)"`
+	Data        string   `long:"data" description:"The data file to use ('-' for stdin)"`
+	DataFormat  string   `long:"data-format" description:"The data format to use (json, yaml, toml, hcl or jsonnet). Files with a .jsonnet extension are always evaluated as jsonnet" default:"json"`
+	DataSchema  string   `long:"data-schema" description:"JSON schema that the data, merged with the extra data, must satisfy before any template is executed"`
+	PythonBools bool     `long:"python-bools" description:"Read booleans as python does: bare True/False tokens of json, toml and hcl data, and YAML 1.1 booleans (yes/no, on/off...) of yaml data"`
+	Output      string   `long:"output" short:"o" description:"The output file to create ('-' for stdout)"`
+	Delims      string   `long:"delims" description:"Template delimiters format (e.g., '[[.]]' or '{{.}}')" default:"{{.}}"`
+	ExtraData   []string `long:"extra-data" description:"Extra data to pass in the format: key=value, or key:=json for non-string values"`
+	IncludeDirs []string `long:"include-dir" description:"Directories of helper templates, each available as a named template via its relative path"`
+	Renders     []string `long:"render" description:"Additional template to output pair to render in the format: src=template,dst=output"`
+	Bundles     []string `long:"bundle" description:"Templates rendered individually to the output declared in their front matter (glob patterns are expanded)"`
+
+	Each           string `long:"each" description:"Render --template once per item of the list at this dot-separated path of the data. The item and its index are available as .item and .index"`
+	OutputTemplate string `long:"output-template" description:"With --each, template of the output path, executed with the item as data (e.g. 'out/{{.name}}.yaml')"`
+
+	Watch         bool          `long:"watch" description:"Re-render the outputs whenever a template or data file changes"`
+	WatchDebounce time.Duration `long:"watch-debounce" description:"How long inputs must be left unchanged before re-rendering" default:"200ms"`
+	Trace         bool          `long:"trace" description:"Log the templates as they are executed, and the first missing key of each output along with its location"`
+	DumpData      string        `long:"dump-data" description:"File to write the data model to, as json, once loaded and merged with the extra data"`
+	Check         bool          `long:"check" description:"Instead of writing the outputs, fail with a diff if they are not up to date"`
+	OutputSchema  string        `long:"output-schema" description:"JSON schema that rendered outputs must satisfy before being written"`
+	Format        bool          `long:"format" description:"Canonically format the outputs based on their extension: gofmt for .go, sorted keys for .json, re-marshaled .yaml/.yml"`
+	OutputMode    string        `long:"output-mode" description:"Permission mode of the output files, in octal" default:"0644"`
+	Executable    bool          `long:"executable" description:"Make the output files executable"`
+	Timestamp     string        `long:"timestamp" description:"Time returned by the now function, in seconds since the unix epoch or in the RFC 3339 format. Defaults to $SOURCE_DATE_EPOCH, if set"`
+	Seed          *int64        `long:"seed" description:"Seed of the random functions (uuidv4, randAlphaNum, randInt...), so that they return the same values on every render"`
+	AllowExec     []string      `long:"allow-exec" description:"Command that templates are allowed to run with the exec function"`
+	ExecTimeout   time.Duration `long:"exec-timeout" description:"Timeout of commands run with the exec function" default:"30s"`
+	Serve         bool          `long:"serve" description:"Stay resident and handle the requests read from stdin, one json object per line holding the arguments of an invocation. Parsed templates and files are cached across requests"`
+}
+
+var opts options
+
+// renderJob renders a set of templates to an output file.
+type renderJob struct {
+	templatePaths []string
+	output        string
+
+	// If set, the templates are rendered once per item of the list found at this path of the data, to the output
+	// computed by the output template.
+	each           string
+	outputTemplate string
+}
+
+// parseRenderSpec parses a --render value of the form 'src=template,dst=output'.
+func parseRenderSpec(spec string) (*renderJob, error) {
+	job := &renderJob{}
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", part)
+		}
+		switch key {
+		case "src":
+			job.templatePaths = append(job.templatePaths, value)
+		case "dst":
+			if job.output != "" {
+				return nil, fmt.Errorf("dst specified more than once")
+			}
+			job.output = value
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if len(job.templatePaths) == 0 || job.output == "" {
+		return nil, fmt.Errorf("both src and dst must be specified")
+	}
+	return job, nil
 }
 
 func parseDelims(format string) (left, right string, err error) {
@@ -40,96 +114,220 @@ func parseDelims(format string) (left, right string, err error) {
 	return left, right, nil
 }
 
-func main() {
-	flags.MustParse(&opts)
-	if opts.Output == "" {
-		log.Fatal("--output is required")
+// expandTemplatePaths expands any glob pattern in the given paths.
+// Matches are sorted so templates are always parsed in the same order.
+func expandTemplatePaths(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			paths = append(paths, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("expanding template pattern %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no template matches pattern %s", pattern)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// parseIncludeDirs parses every file in the given directories as a named template, using the file's path
+// relative to its include directory as the name. Include directories are parsed before the main templates, so that
+// the latter can use and override any template defined in them.
+func parseIncludeDirs(tmpl *template.Template, dirs []string) error {
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			name, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			content, err := readFile(path)
+			if err != nil {
+				return err
+			}
+			if _, err := tmpl.New(filepath.ToSlash(name)).Parse(content); err != nil {
+				return fmt.Errorf("parsing %s: %w", path, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("parsing include dir %s: %w", dir, err)
+		}
 	}
-	if len(opts.Templates) == 0 {
-		log.Fatal("--output is required")
+	return nil
+}
+
+// readInput reads the content of the given path, or of stdin if the path is '-'.
+func readInput(path string) ([]byte, error) {
+	if path == stdioPath {
+		return io.ReadAll(os.Stdin)
 	}
+	return os.ReadFile(path)
+}
 
-	// Parse delimiters
-	leftDelim, rightDelim, err := parseDelims(opts.Delims)
+// logToStderr sends every log line, and the output of the debug function, to stderr. The logger writes through hooks,
+// some of which target stdout, so they are dropped rather than merely adding stderr as an output.
+func logToStderr() {
+	log.ReplaceHooks(make(logrus.LevelHooks))
+	log.SetOutput(os.Stderr)
+	debugOutput = os.Stderr
+}
+
+// parseFileMode parses an octal permission mode.
+func parseFileMode(mode string) (fs.FileMode, error) {
+	parsedMode, err := strconv.ParseUint(mode, 8, 32)
 	if err != nil {
-		log.Fatalf("invalid delimiter format: %v", err)
+		return 0, fmt.Errorf("parsing %s: %w", mode, err)
+	}
+	if parsedMode&^uint64(fs.ModePerm) != 0 {
+		return 0, fmt.Errorf("%s is not a permission mode", mode)
 	}
+	return fs.FileMode(parsedMode), nil
+}
+
+// writeOutput writes content to the given path with the given mode, or to stdout if the path is '-'.
+// Missing parent directories are created.
+func writeOutput(path string, content []byte, mode fs.FileMode) error {
+	if path == stdioPath {
+		_, err := os.Stdout.Write(content)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	if err := os.WriteFile(path, content, mode); err != nil {
+		return err
+	}
+	// The mode passed to WriteFile is subject to the umask and is ignored for existing files.
+	return os.Chmod(path, mode)
+}
 
-	// Use to do operations once and only once.
-	cache := map[string]bool{}
-	doOnce := func(key string) bool {
-		if _, ok := cache[key]; ok {
-			return false // Already done.
+func main() {
+	flags.MustParse(&opts)
+	if opts.Serve {
+		if err := serve(); err != nil {
+			log.Fatal(err)
 		}
-		cache[key] = true
-		return true
+		return
 	}
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	// Read the template file
-	funcMap := sprig.TxtFuncMap()
-	funcMap["doOnce"] = doOnce
-	for k, v := range customFuncMap {
-		funcMap[k] = v
+// run renders the outputs as specified by the options.
+func run() error {
+	if (opts.Each == "") != (opts.OutputTemplate == "") {
+		return fmt.Errorf("--each and --output-template must be used together")
 	}
-	// Parse the template
-	tmpl := template.New("template").Funcs(funcMap).Delims(leftDelim, rightDelim)
-	for _, templatePath := range opts.Templates {
-		bytes, err := os.ReadFile(templatePath)
-		if err != nil {
-			log.Fatalf("reading template file: %v", err)
-		}
-		tmpl, err = tmpl.Parse(string(bytes))
-		if err != nil {
-			log.Fatalf("parsing template: %v", err)
-		}
+	if opts.Each != "" && opts.Output != "" {
+		return fmt.Errorf("--output cannot be used with --each")
+	}
+	if len(opts.Templates) > 0 && opts.Output == "" && opts.Each == "" {
+		return fmt.Errorf("--output is required")
+	}
+	if (opts.Output != "" || opts.Each != "") && len(opts.Templates) == 0 {
+		return fmt.Errorf("--template is required")
 	}
 
-	// Read the data file
-	data := map[string]any{}
-	if opts.Data != "" {
-		dataBytes, err := os.ReadFile(opts.Data)
+	// Collect the render jobs.
+	jobs := []*renderJob{}
+	if opts.Output != "" {
+		jobs = append(jobs, &renderJob{templatePaths: opts.Templates, output: opts.Output})
+	}
+	if opts.Each != "" {
+		jobs = append(jobs, &renderJob{templatePaths: opts.Templates, each: opts.Each, outputTemplate: opts.OutputTemplate})
+	}
+	for _, spec := range opts.Renders {
+		job, err := parseRenderSpec(spec)
 		if err != nil {
-			log.Fatalf("reading data file: %v", err)
+			return fmt.Errorf("invalid render %s: %w", spec, err)
 		}
-		fixedDataBytes := bytes.ReplaceAll(dataBytes, []byte("True"), []byte("true"))
-		fixedDataBytes = bytes.ReplaceAll(fixedDataBytes, []byte("False"), []byte("false"))
-
-		// Unmarshal the data into a map
-		switch opts.DataFormat {
-		case "json":
-			if err := json.Unmarshal(fixedDataBytes, &data); err != nil {
-				log.Fatalf("unmarshaling json data: %v", err)
-			}
-		case "yaml":
-			if err := yaml.Unmarshal(fixedDataBytes, &data); err != nil {
-				log.Fatalf("unmarshaling yaml data: %v", err)
+		jobs = append(jobs, job)
+	}
+	bundlePaths, err := expandTemplatePaths(opts.Bundles)
+	if err != nil {
+		return fmt.Errorf("invalid bundle: %w", err)
+	}
+	for _, bundlePath := range bundlePaths {
+		jobs = append(jobs, &renderJob{templatePaths: []string{bundlePath}})
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("--template and --output, --render, or --bundle, are required")
+	}
+	for _, job := range jobs {
+		if job.output == stdioPath {
+			if serving {
+				return fmt.Errorf("cannot write to stdout in serve mode")
 			}
-		default:
-			log.Fatalf("unknown data format: %s", opts.DataFormat)
+			// Keep stdout clean for the rendered output.
+			logToStderr()
 		}
 	}
 
-	// Process additional data.
-	extraData := map[string]string{}
-	if len(opts.ExtraData) > 0 {
-		data["extra"] = extraData
+	// Parse delimiters
+	leftDelim, rightDelim, err := parseDelims(opts.Delims)
+	if err != nil {
+		return fmt.Errorf("invalid delimiter format: %w", err)
+	}
+	outputFileMode, err = parseFileMode(opts.OutputMode)
+	if err != nil {
+		return fmt.Errorf("invalid output mode: %w", err)
+	}
+	if opts.Executable {
+		outputFileMode |= 0111
+	}
+
+	// Wraps a write function with the output formatting and validation, if any.
+	wrapWrite := func(write writeFunc) writeFunc {
+		if opts.OutputSchema != "" {
+			write = validateOutput(write)
+		}
+		if opts.Format {
+			write = formatOutput(write)
+		}
+		return write
 	}
-	for _, extra := range opts.ExtraData {
-		split := strings.Split(extra, ":")
-		if len(split) != 2 {
-			log.Fatalf("invalid extra data: %s", extra)
+
+	if opts.Check {
+		if opts.Watch {
+			return fmt.Errorf("--check cannot be used with --watch")
+		}
+		checker := &outputChecker{}
+		if err := render(jobs, leftDelim, rightDelim, wrapWrite(checker.check)); err != nil {
+			return err
 		}
-		extraData[split[0]] = split[1]
+		if len(checker.diffs) > 0 {
+			diff := strings.Join(checker.diffs, "\n")
+			if serving {
+				// Stdout is reserved for the responses.
+				return fmt.Errorf("%d output(s) are not up to date:\n%s", len(checker.diffs), diff)
+			}
+			fmt.Print(diff)
+			return fmt.Errorf("%d output(s) are not up to date", len(checker.diffs))
+		}
+		log.Printf("Outputs are up to date")
+		return nil
 	}
 
-	// Execute the template with the data
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		log.Fatalf("executing template: %v", err)
+	if opts.Watch {
+		if opts.Data == stdioPath {
+			return fmt.Errorf("--watch cannot be used with data read from stdin")
+		}
+		watch(jobs, func() error { return render(jobs, leftDelim, rightDelim, wrapWrite(writeOutput)) })
+		return nil
 	}
-	// Write the result to the output file
-	if err := os.WriteFile(opts.Output, buf.Bytes(), 0644); err != nil {
-		log.Fatalf("writing output file: %v", err)
+	if err := render(jobs, leftDelim, rightDelim, wrapWrite(writeOutput)); err != nil {
+		return err
 	}
 	log.Printf("Successfully processed template and data")
+	return nil
 }
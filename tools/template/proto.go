@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bufbuild/protocompile/ast"
+	"github.com/bufbuild/protocompile/parser"
+	"github.com/bufbuild/protocompile/reporter"
+)
+
+const (
+	// natsPublishersOption is the option field listing the nats publishers a service requires.
+	natsPublishersOption = "require_nats_publishers"
+)
+
+var (
+	filepathToProtoFile = map[string]*protoFile{}
+)
+
+// protoFile is a parsed proto file, as exposed to templates.
+type protoFile struct {
+	Package  string
+	Options  map[string]any
+	Services []*protoService
+
+	node *ast.FileNode
+}
+
+// protoService is a service of a proto file.
+type protoService struct {
+	Name    string
+	Options map[string]any
+	Methods []*protoMethod
+}
+
+// protoMethod is a method of a proto service.
+type protoMethod struct {
+	Name            string
+	InputType       string
+	OutputType      string
+	ClientStreaming bool
+	ServerStreaming bool
+	Options         map[string]any
+}
+
+// parseProtoFile parses the proto file of the given build target (e.g. '//path/to:service' for path/to/service.proto).
+// Files are only parsed, not compiled: option values are resolved from their literal values in the source, and option
+// names are kept as written rather than resolved against their descriptors (see setOption).
+func parseProtoFile(target string) (*protoFile, error) {
+	filepath := strings.TrimPrefix(target, "//")
+	filepath = strings.ReplaceAll(filepath, ":", "/") + ".proto"
+	if file, ok := filepathToProtoFile[filepath]; ok {
+		return file, nil
+	}
+	content, err := readFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	node, err := parser.Parse(filepath, strings.NewReader(content), reporter.NewHandler(nil))
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filepath, err)
+	}
+
+	file := &protoFile{Options: map[string]any{}, node: node}
+	for _, decl := range node.Decls {
+		switch decl := decl.(type) {
+		case *ast.PackageNode:
+			file.Package = string(decl.Name.AsIdentifier())
+		case *ast.OptionNode:
+			setOption(file.Options, decl)
+		case *ast.ServiceNode:
+			file.Services = append(file.Services, newProtoService(decl))
+		}
+	}
+	filepathToProtoFile[filepath] = file
+	return file, nil
+}
+
+func newProtoService(node *ast.ServiceNode) *protoService {
+	service := &protoService{Name: string(node.Name.AsIdentifier()), Options: map[string]any{}}
+	for _, decl := range node.Decls {
+		switch decl := decl.(type) {
+		case *ast.OptionNode:
+			setOption(service.Options, decl)
+		case *ast.RPCNode:
+			method := &protoMethod{
+				Name:            string(decl.Name.AsIdentifier()),
+				InputType:       string(decl.Input.MessageType.AsIdentifier()),
+				OutputType:      string(decl.Output.MessageType.AsIdentifier()),
+				ClientStreaming: decl.Input.Stream != nil,
+				ServerStreaming: decl.Output.Stream != nil,
+				Options:         map[string]any{},
+			}
+			for _, rpcDecl := range decl.Decls {
+				if option, ok := rpcDecl.(*ast.OptionNode); ok {
+					setOption(method.Options, option)
+				}
+			}
+			service.Methods = append(service.Methods, method)
+		}
+	}
+	return service
+}
+
+// setOption sets an option in the given map, keyed by the first part of its name (e.g. '(pkg.option)'). The remaining
+// parts of the name are a field path into that option, so that 'option (pkg.option).field = 1;' and
+// 'option (pkg.option) = {field: 1};' are exposed to templates in the same shape. Names are not resolved against their
+// descriptors: '(option)' and '(pkg.option)' remain distinct keys.
+func setOption(options map[string]any, node *ast.OptionNode) {
+	parts := node.Name.Parts
+	fields := options
+	for _, part := range parts[:len(parts)-1] {
+		nested, ok := fields[part.Value()].(map[string]any)
+		if !ok {
+			nested = map[string]any{}
+			fields[part.Value()] = nested
+		}
+		fields = nested
+	}
+	name := parts[len(parts)-1].Value()
+	value := optionValue(node.Val)
+	existingFields, existingIsMap := fields[name].(map[string]any)
+	valueFields, valueIsMap := value.(map[string]any)
+	if !existingIsMap || !valueIsMap {
+		addOptionField(fields, name, value)
+		return
+	}
+	// The option was already partially set through field paths.
+	for fieldName, fieldValue := range valueFields {
+		addOptionField(existingFields, fieldName, fieldValue)
+	}
+}
+
+// addOptionField adds a field to the given map. Fields set more than once are collected in a list.
+func addOptionField(fields map[string]any, name string, value any) {
+	existing, ok := fields[name]
+	if !ok {
+		fields[name] = value
+		return
+	}
+	if values, ok := existing.([]any); ok {
+		fields[name] = append(values, value)
+	} else {
+		fields[name] = []any{existing, value}
+	}
+}
+
+// optionValue converts an option value to a template friendly value. Message literals become maps keyed by field
+// name (fields repeated in a message literal are collected in a list), and array literals become lists.
+func optionValue(node ast.ValueNode) any {
+	switch value := node.Value().(type) {
+	case []ast.ValueNode:
+		values := make([]any, 0, len(value))
+		for _, element := range value {
+			values = append(values, optionValue(element))
+		}
+		return values
+	case []*ast.MessageFieldNode:
+		fields := map[string]any{}
+		for _, field := range value {
+			addOptionField(fields, field.Name.Value(), optionValue(field.Val))
+		}
+		return fields
+	case ast.Identifier:
+		switch value {
+		case "true":
+			return true
+		case "false":
+			return false
+		}
+		return string(value)
+	default:
+		return value
+	}
+}
+
+// grpcSvcNames returns the names of all the services of the given proto target.
+func grpcSvcNames(target string) ([]string, error) {
+	file, err := parseProtoFile(target)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(file.Services))
+	for _, service := range file.Services {
+		names = append(names, service.Name)
+	}
+	return names, nil
+}
+
+// grpcSvcName returns the name of the first service of the given proto target.
+func grpcSvcName(target string) (string, error) {
+	file, err := parseProtoFile(target)
+	if err != nil {
+		return "", err
+	}
+	if len(file.Services) == 0 {
+		return "", fmt.Errorf("no service found in %s", target)
+	}
+	return file.Services[0].Name, nil
+}
+
+// grpcNatsPublishers returns the nats publishers required by the given proto target, wherever they are set in its
+// options.
+func grpcNatsPublishers(target string) ([]string, error) {
+	file, err := parseProtoFile(target)
+	if err != nil {
+		return nil, err
+	}
+	publishers := []string{}
+	collect := func(node ast.ValueNode) {
+		switch value := optionValue(node).(type) {
+		case string:
+			publishers = append(publishers, value)
+		case []any:
+			for _, element := range value {
+				if publisher, ok := element.(string); ok {
+					publishers = append(publishers, publisher)
+				}
+			}
+		}
+	}
+	visitor := &ast.SimpleVisitor{
+		DoVisitOptionNode: func(node *ast.OptionNode) error {
+			if parts := node.Name.Parts; parts[len(parts)-1].Value() == natsPublishersOption {
+				collect(node.Val)
+			}
+			return nil
+		},
+		DoVisitMessageFieldNode: func(node *ast.MessageFieldNode) error {
+			if node.Name.Value() == natsPublishersOption {
+				collect(node.Val)
+			}
+			return nil
+		},
+	}
+	if err := ast.Walk(file.node, visitor); err != nil {
+		return nil, err
+	}
+	return publishers, nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// yaml11Bools are the plain scalars that PyYAML resolves as booleans. The YAML 1.1 spec also lists y and n, which
+	// PyYAML, like most parsers, leaves as strings.
+	yaml11Bools = map[string]bool{
+		"yes": true, "Yes": true, "YES": true,
+		"no": false, "No": false, "NO": false,
+		"true": true, "True": true, "TRUE": true,
+		"false": false, "False": false, "FALSE": false,
+		"on": true, "On": true, "ON": true,
+		"off": false, "Off": false, "OFF": false,
+	}
+	// pythonBoolTokens maps python booleans to their json, toml and hcl equivalent.
+	pythonBoolTokens = map[string]string{
+		"True":  "true",
+		"False": "false",
+	}
+)
+
+// rewritePythonBools rewrites the bare True and False values of a json, toml or hcl document to true and false.
+// Strings, comments and keys (e.g. toml table headers) are left untouched, as are tokens that are only part of a larger
+// word (e.g. TrueNorth).
+func rewritePythonBools(content []byte, format string) []byte {
+	var buf bytes.Buffer
+	// The last significant byte, and whether it is a bracket opening a toml table header.
+	var previous byte
+	var previousIsHeader bool
+	// Whether only whitespace was seen since the start of the line.
+	lineStart := true
+	for i := 0; i < len(content); {
+		rest := content[i:]
+		if n := commentLength(rest, format); n > 0 {
+			buf.Write(rest[:n])
+			i += n
+			continue
+		}
+		if n := stringLength(rest, format); n > 0 {
+			buf.Write(rest[:n])
+			i += n
+			previous, previousIsHeader, lineStart = '"', false, false
+			continue
+		}
+
+		c := content[i]
+		if isTokenByte(c) {
+			end := i
+			for end < len(content) && isTokenByte(content[end]) {
+				end++
+			}
+			token := content[i:end]
+			replacement, ok := pythonBoolTokens[string(token)]
+			if ok && isValuePosition(previous, previousIsHeader, content[end:]) {
+				buf.WriteString(replacement)
+			} else {
+				buf.Write(token)
+			}
+			i = end
+			previous, previousIsHeader, lineStart = c, false, false
+			continue
+		}
+
+		buf.WriteByte(c)
+		i++
+		switch c {
+		case '\n':
+			lineStart = true
+		case ' ', '\t', '\r':
+		default:
+			previousIsHeader = format == "toml" && c == '[' && (lineStart || previous == '[' && previousIsHeader)
+			previous, lineStart = c, false
+		}
+	}
+	return buf.Bytes()
+}
+
+// isValuePosition returns true if a token preceded by the given significant byte and followed by the given content is
+// a value rather than a key.
+func isValuePosition(previous byte, previousIsHeader bool, next []byte) bool {
+	switch previous {
+	case ':', '=', ',':
+	case '[':
+		if previousIsHeader {
+			return false
+		}
+	default:
+		return false
+	}
+	next = bytes.TrimLeft(next, " \t")
+	return len(next) == 0 || (next[0] != '=' && next[0] != ':')
+}
+
+// commentLength returns the length of the comment at the start of the content, or 0 if it doesn't start with one.
+func commentLength(content []byte, format string) int {
+	lineComment := format == "toml" && bytes.HasPrefix(content, []byte("#")) ||
+		format == "hcl" && (bytes.HasPrefix(content, []byte("#")) || bytes.HasPrefix(content, []byte("//")))
+	if lineComment {
+		if end := bytes.IndexByte(content, '\n'); end >= 0 {
+			return end
+		}
+		return len(content)
+	}
+	if format == "hcl" && bytes.HasPrefix(content, []byte("/*")) {
+		if end := bytes.Index(content[2:], []byte("*/")); end >= 0 {
+			return end + 4
+		}
+		return len(content)
+	}
+	return 0
+}
+
+// stringLength returns the length of the string at the start of the content, including its quotes, or 0 if it doesn't
+// start with one. An unterminated string spans the rest of the content.
+func stringLength(content []byte, format string) int {
+	var quote string
+	switch {
+	case format == "toml" && bytes.HasPrefix(content, []byte(`"""`)):
+		quote = `"""`
+	case format == "toml" && bytes.HasPrefix(content, []byte("'''")):
+		quote = "'''"
+	case bytes.HasPrefix(content, []byte(`"`)):
+		quote = `"`
+	case format == "toml" && bytes.HasPrefix(content, []byte("'")):
+		quote = "'"
+	default:
+		return 0
+	}
+	// Only double-quoted strings have escape sequences.
+	escapes := quote[0] == '"'
+	for i := len(quote); i < len(content); i++ {
+		if escapes && content[i] == '\\' {
+			i++
+			continue
+		}
+		if bytes.HasPrefix(content[i:], []byte(quote)) {
+			return i + len(quote)
+		}
+	}
+	return len(content)
+}
+
+// isTokenByte returns true if the byte can be part of a bare token.
+func isTokenByte(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// resolveYAML11Bools turns the plain scalar values of the yaml node that YAML 1.1 considers booleans into booleans.
+// Mapping keys are left as is, so that objects keep string keys.
+func resolveYAML11Bools(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			resolveYAML11Bools(child)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			resolveYAML11Bools(node.Content[i])
+		}
+	case yaml.ScalarNode:
+		if node.Style != 0 || node.ShortTag() != "!!str" {
+			return // Quoted, explicitly tagged or not a string.
+		}
+		if value, ok := yaml11Bools[node.Value]; ok {
+			node.Tag = "!!bool"
+			if value {
+				node.Value = "true"
+			} else {
+				node.Value = "false"
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestRewritePythonBools(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		format   string
+		input    string
+		expected string
+	}{
+		{"json values", "json", `{"a": True, "b": [False, True]}`, `{"a": true, "b": [false, true]}`},
+		{"json strings", "json", `{"a": "True", "b": "say \"True\"", "c": True}`, `{"a": "True", "b": "say \"True\"", "c": true}`},
+		{"json larger words", "json", `{"a": TrueNorth, "b": False_}`, `{"a": TrueNorth, "b": False_}`},
+		{"toml values", "toml", "a = True\nb = [True, False]\nc = { d = False }", "a = true\nb = [true, false]\nc = { d = false }"},
+		{"toml comments", "toml", "name = \"x\" # don't\nflag = True # True", "name = \"x\" # don't\nflag = true # True"},
+		{"toml keys", "toml", "True = 1\n[True]\n[[False]]\nc = { True = False }", "True = 1\n[True]\n[[False]]\nc = { True = false }"},
+		{"toml literal strings", "toml", "a = 'True\\'\nb = True", "a = 'True\\'\nb = true"},
+		{"toml multi-line strings", "toml", "a = \"\"\"\n\"True\" True\n\"\"\"\nb = '''True'''\nc = True", "a = \"\"\"\n\"True\" True\n\"\"\"\nb = '''True'''\nc = true"},
+		{"hcl values", "hcl", "a = True\nb = [False]", "a = true\nb = [false]"},
+		{"hcl comments", "hcl", "// don't\n# don't\n/* don't\nTrue */\na = True", "// don't\n# don't\n/* don't\nTrue */\na = true"},
+		{"hcl keys", "hcl", "True = 1\nTrue {\n  False = True\n}", "True = 1\nTrue {\n  False = true\n}"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := string(rewritePythonBools([]byte(tc.input), tc.format)); actual != tc.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tc.expected, actual)
+			}
+		})
+	}
+}
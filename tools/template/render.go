@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Masterminds/sprig/v3"
+	"github.com/google/go-jsonnet"
+	"github.com/hashicorp/hcl"
+	"gopkg.in/yaml.v3"
+
+	"github.com/malonaz/malonaz/tools/validate-schema/schema"
+)
+
+// loadData reads the data file and the extra data into a single document.
+func loadData() (map[string]any, error) {
+	data := map[string]any{}
+	if opts.Data != "" {
+		dataBytes, err := readInput(opts.Data)
+		if err != nil {
+			return nil, fmt.Errorf("reading data file: %w", err)
+		}
+		dataFormat := opts.DataFormat
+		if filepath.Ext(opts.Data) == ".jsonnet" {
+			dataFormat = "jsonnet"
+		}
+		if opts.PythonBools && dataFormat != "yaml" && dataFormat != "jsonnet" {
+			dataBytes = rewritePythonBools(dataBytes, dataFormat)
+		}
+
+		// Unmarshal the data into a map
+		switch dataFormat {
+		case "json":
+			if err := json.Unmarshal(dataBytes, &data); err != nil {
+				return nil, fmt.Errorf("unmarshaling json data: %w", err)
+			}
+		case "yaml":
+			var node yaml.Node
+			if err := yaml.Unmarshal(dataBytes, &node); err != nil {
+				return nil, fmt.Errorf("unmarshaling yaml data: %w", err)
+			}
+			if opts.PythonBools {
+				resolveYAML11Bools(&node)
+			}
+			if node.Kind != 0 {
+				if err := node.Decode(&data); err != nil {
+					return nil, fmt.Errorf("decoding yaml data: %w", err)
+				}
+			}
+		case "toml":
+			if err := toml.Unmarshal(dataBytes, &data); err != nil {
+				return nil, fmt.Errorf("unmarshaling toml data: %w", err)
+			}
+		case "hcl":
+			if err := hcl.Unmarshal(dataBytes, &data); err != nil {
+				return nil, fmt.Errorf("unmarshaling hcl data: %w", err)
+			}
+		case "jsonnet":
+			vm := jsonnet.MakeVM()
+			vm.Importer(&jsonnet.FileImporter{})
+			jsonData, err := vm.EvaluateAnonymousSnippet(opts.Data, string(dataBytes))
+			if err != nil {
+				return nil, fmt.Errorf("evaluating jsonnet data: %w", err)
+			}
+			if err := json.Unmarshal([]byte(jsonData), &data); err != nil {
+				return nil, fmt.Errorf("unmarshaling jsonnet data: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown data format: %s", dataFormat)
+		}
+	}
+
+	// Process additional data.
+	extraData := map[string]any{}
+	if len(opts.ExtraData) > 0 {
+		data["extra"] = extraData
+	}
+	for _, extra := range opts.ExtraData {
+		key, value, err := parseExtraData(extra)
+		if err != nil {
+			return nil, fmt.Errorf("invalid extra data %s: %w", extra, err)
+		}
+		extraData[key] = value
+	}
+	return data, nil
+}
+
+// parseExtraData parses an extra data entry. 'key=value' yields a string value, while 'key:=json' yields the decoded
+// json value, which allows passing numbers, booleans, lists and objects.
+func parseExtraData(extra string) (string, any, error) {
+	key, value, ok := strings.Cut(extra, "=")
+	if !ok {
+		return "", nil, fmt.Errorf("expected key=value or key:=json")
+	}
+	key, isJSON := strings.CutSuffix(key, ":")
+	if key == "" {
+		return "", nil, fmt.Errorf("empty key")
+	}
+	if !isJSON {
+		return key, value, nil
+	}
+	var jsonValue any
+	if err := json.Unmarshal([]byte(value), &jsonValue); err != nil {
+		return "", nil, fmt.Errorf("unmarshaling json value: %w", err)
+	}
+	return key, jsonValue, nil
+}
+
+// writeFunc handles the rendered content of an output.
+type writeFunc func(path string, content []byte, mode fs.FileMode) error
+
+// validateOutput wraps the write function so that rendered content is validated against the output schema first.
+// Outputs with a .yaml or .yml extension are parsed as yaml, others as json.
+func validateOutput(write writeFunc) writeFunc {
+	return func(path string, content []byte, mode fs.FileMode) error {
+		format := "json"
+		if extension := filepath.Ext(path); extension == ".yaml" || extension == ".yml" {
+			format = "yaml"
+		}
+		data, err := schema.Unmarshal(content, format)
+		if err != nil {
+			return fmt.Errorf("parsing rendered %s: %w", path, err)
+		}
+		if err := schema.Validate(opts.OutputSchema, data); err != nil {
+			return fmt.Errorf("validating rendered %s: %w", path, err)
+		}
+		return write(path, content, mode)
+	}
+}
+
+// formatOutput wraps the write function so that rendered content is canonically formatted according to the extension of
+// its output first. Outputs without a known extension are written as is.
+func formatOutput(write writeFunc) writeFunc {
+	return func(path string, content []byte, mode fs.FileMode) error {
+		formatter, ok := extensionToFormatter[filepath.Ext(path)]
+		if !ok {
+			return write(path, content, mode)
+		}
+		formattedContent, err := formatter(content)
+		if err != nil {
+			return fmt.Errorf("formatting rendered %s: %w", path, err)
+		}
+		return write(path, formattedContent, mode)
+	}
+}
+
+// render renders every job against the data and hands each result to the write function. The data and the render state
+// are shared by all jobs.
+func render(jobs []*renderJob, leftDelim, rightDelim string, write writeFunc) error {
+	funcMap := sprig.TxtFuncMap()
+	for k, v := range customFuncMap {
+		funcMap[k] = v
+	}
+	for k, v := range newRenderState().funcMap() {
+		funcMap[k] = v
+	}
+	overrides, err := reproducibleFuncMap()
+	if err != nil {
+		return err
+	}
+	for k, v := range overrides {
+		funcMap[k] = v
+	}
+	if opts.Trace {
+		funcMap[traceFuncName] = traceTemplate
+	}
+
+	data, err := loadData()
+	if err != nil {
+		return err
+	}
+	if opts.DataSchema != "" {
+		if err := schema.Validate(opts.DataSchema, data); err != nil {
+			return fmt.Errorf("validating data: %w", err)
+		}
+	}
+	if opts.DumpData != "" {
+		if err := dumpData(opts.DumpData, data); err != nil {
+			return fmt.Errorf("dumping data: %w", err)
+		}
+	}
+
+	for _, job := range jobs {
+		templatePaths, err := expandTemplatePaths(job.templatePaths)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+
+		tmpl, jobFrontMatter, err := parseTemplates(templatePaths, funcMap, leftDelim, rightDelim)
+		if err != nil {
+			return err
+		}
+		if opts.Trace {
+			log.Printf("Rendering %s", strings.Join(templatePaths, ", "))
+			if err := instrumentTemplates(tmpl); err != nil {
+				return err
+			}
+		}
+
+		// Apply the front matter.
+		if jobFrontMatter.Strict {
+			tmpl.Option("missingkey=error")
+		}
+		mode := outputFileMode
+		if jobFrontMatter.Mode != "" {
+			if mode, err = parseFileMode(jobFrontMatter.Mode); err != nil {
+				return fmt.Errorf("invalid front matter mode: %w", err)
+			}
+		}
+
+		if job.each == "" {
+			output := job.output
+			if output == "" {
+				if jobFrontMatter.Output == "" {
+					return fmt.Errorf("no output declared for %s", strings.Join(templatePaths, ", "))
+				}
+				outputTmpl, err := template.New("output").Funcs(funcMap).Delims(leftDelim, rightDelim).Parse(jobFrontMatter.Output)
+				if err != nil {
+					return fmt.Errorf("parsing front matter output: %w", err)
+				}
+				var buf bytes.Buffer
+				if err := outputTmpl.Execute(&buf, data); err != nil {
+					return fmt.Errorf("executing front matter output: %w", err)
+				}
+				output = buf.String()
+			}
+			if err := execute(tmpl, data, output, mode, write); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Render the templates once per item of the list.
+		items, err := lookupList(data, job.each)
+		if err != nil {
+			return fmt.Errorf("looking up %s: %w", job.each, err)
+		}
+		outputTmpl, err := template.New("output").Funcs(funcMap).Delims(leftDelim, rightDelim).Parse(job.outputTemplate)
+		if err != nil {
+			return fmt.Errorf("parsing output template: %w", err)
+		}
+		for i, item := range items {
+			var output bytes.Buffer
+			if err := outputTmpl.Execute(&output, item); err != nil {
+				return fmt.Errorf("executing output template for item %d: %w", i, err)
+			}
+			itemData := maps.Clone(data)
+			itemData["item"] = item
+			itemData["index"] = i
+			if err := execute(tmpl, itemData, output.String(), mode, write); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parsedTemplates are templates parsed along with their include directories.
+type parsedTemplates struct {
+	tmpl        *template.Template
+	frontMatter *frontMatter
+	// The modification times of the parsed files, to detect when the templates must be parsed again.
+	pathToModTime map[string]time.Time
+}
+
+// keyToParsedTemplates caches parsed templates, so that they are not parsed again until their files change.
+var keyToParsedTemplates = map[string]*parsedTemplates{}
+
+// parseTemplates parses the include directories and the given templates, and merges their front matters. It returns a
+// clone of the cached templates, bound to the given functions, if none of their files changed since they were parsed.
+func parseTemplates(templatePaths []string, funcMap template.FuncMap, leftDelim, rightDelim string) (*template.Template, *frontMatter, error) {
+	key := strings.Join(slices.Concat([]string{leftDelim, rightDelim}, opts.IncludeDirs, templatePaths), "\x00")
+	pathToModTime := snapshotModTimes(slices.Concat(includeDirPaths(), templatePaths))
+	parsed, ok := keyToParsedTemplates[key]
+	if !ok || !maps.Equal(parsed.pathToModTime, pathToModTime) {
+		tmpl := template.New("template").Funcs(funcMap).Delims(leftDelim, rightDelim)
+		if err := parseIncludeDirs(tmpl, opts.IncludeDirs); err != nil {
+			return nil, nil, fmt.Errorf("parsing includes: %w", err)
+		}
+		jobFrontMatter := &frontMatter{}
+		for _, templatePath := range templatePaths {
+			content, err := readFile(templatePath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("reading template file: %w", err)
+			}
+			matter, body := splitFrontMatter(content)
+			if matter != nil {
+				jobFrontMatter.merge(matter)
+			}
+			tmpl, err = tmpl.Parse(body)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parsing template %s: %w", templatePath, err)
+			}
+		}
+		parsed = &parsedTemplates{tmpl: tmpl, frontMatter: jobFrontMatter, pathToModTime: pathToModTime}
+		keyToParsedTemplates[key] = parsed
+	}
+
+	tmpl, err := parsed.tmpl.Clone()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cloning templates: %w", err)
+	}
+	return tmpl.Funcs(funcMap), parsed.frontMatter, nil
+}
+
+// execute executes the template with the data and writes the result to the output.
+func execute(tmpl *template.Template, data map[string]any, output string, mode fs.FileMode, write writeFunc) error {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("executing template for %s: %w", output, err)
+	}
+	if opts.Trace {
+		traceMissingKey(tmpl, data, output)
+	}
+	// Write the result to the output file
+	if err := write(output, buf.Bytes(), mode); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
+}
+
+// lookupList returns the list found at the given dot-separated path of the data (e.g. 'deployment.services').
+func lookupList(data map[string]any, path string) ([]any, error) {
+	var value any = data
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an object", key)
+		}
+		if value, ok = object[key]; !ok {
+			return nil, fmt.Errorf("%s not found", key)
+		}
+	}
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a list, got %T", value)
+	}
+	return list, nil
+}
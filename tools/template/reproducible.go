@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// sourceDateEpochEnv is the standard environment variable holding the timestamp of reproducible builds.
+	sourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
+	alphaChars   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	numericChars = "0123456789"
+)
+
+// reproducibleFuncMap returns the functions overriding sprig's time and randomness functions, with a fixed time if
+// --timestamp or SOURCE_DATE_EPOCH is set, and seeded randomness if --seed is set. A new random generator is seeded
+// for every call, so that every render produces the same values.
+func reproducibleFuncMap() (template.FuncMap, error) {
+	funcMap := template.FuncMap{}
+	timestamp := opts.Timestamp
+	if timestamp == "" {
+		timestamp = os.Getenv(sourceDateEpochEnv)
+	}
+	if timestamp != "" {
+		now, err := parseTimestamp(timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %w", err)
+		}
+		funcMap["now"] = func() time.Time { return now }
+	}
+
+	if opts.Seed != nil {
+		random := rand.New(rand.NewSource(*opts.Seed))
+		randString := func(chars string) func(int) string {
+			return func(count int) string {
+				var builder strings.Builder
+				for range count {
+					builder.WriteByte(chars[random.Intn(len(chars))])
+				}
+				return builder.String()
+			}
+		}
+		var asciiChars strings.Builder
+		for c := byte(' '); c <= '~'; c++ {
+			asciiChars.WriteByte(c)
+		}
+
+		funcMap["uuidv4"] = func() (string, error) {
+			id, err := uuid.NewRandomFromReader(random)
+			if err != nil {
+				return "", err
+			}
+			return id.String(), nil
+		}
+		funcMap["randAlphaNum"] = randString(alphaChars + numericChars)
+		funcMap["randAlpha"] = randString(alphaChars)
+		funcMap["randNumeric"] = randString(numericChars)
+		funcMap["randAscii"] = randString(asciiChars.String())
+		funcMap["randInt"] = func(min, max int) int { return min + random.Intn(max-min) }
+		funcMap["randBytes"] = func(count int) string {
+			bytes := make([]byte, count)
+			random.Read(bytes)
+			return base64.StdEncoding.EncodeToString(bytes)
+		}
+		funcMap["shuffle"] = func(s string) string {
+			runes := []rune(s)
+			random.Shuffle(len(runes), func(i, j int) { runes[i], runes[j] = runes[j], runes[i] })
+			return string(runes)
+		}
+	}
+	return funcMap, nil
+}
+
+// parseTimestamp parses a timestamp given in seconds since the unix epoch, or in the RFC 3339 format.
+func parseTimestamp(timestamp string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return time.Parse(time.RFC3339, timestamp)
+}
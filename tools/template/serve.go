@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	goflags "github.com/jessevdk/go-flags"
+)
+
+const (
+	// maxServeRequestSize is the maximum size of a request line in serve mode.
+	maxServeRequestSize = 1 << 20
+)
+
+// serving is true if the tool handles requests in serve mode, in which case stdin and stdout are reserved for them.
+var serving bool
+
+// serveRequest is a request of the serve mode, e.g. {"args": ["--template", "a.tmpl", "--output", "a"]}.
+type serveRequest struct {
+	// Args are the command line arguments of the invocation.
+	Args []string `json:"args"`
+}
+
+// serveResponse is the response to a request of the serve mode, e.g. {"error": "--output is required"}.
+type serveResponse struct {
+	// Error is set if the invocation failed.
+	Error string `json:"error,omitempty"`
+}
+
+// serve handles the requests read from stdin, one per line, and writes one response per line to stdout as each
+// request is handled. Parsed templates and file contents are cached across requests, until the files change on disk.
+func serve() error {
+	serving = true
+	logToStderr()
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(nil, maxServeRequestSize)
+	encoder := json.NewEncoder(os.Stdout)
+	for scanner.Scan() {
+		response := &serveResponse{}
+		if err := handleServeRequest(scanner.Bytes()); err != nil {
+			log.Errorf("handling request: %v", err)
+			response.Error = err.Error()
+		}
+		if err := encoder.Encode(response); err != nil {
+			return fmt.Errorf("writing response: %w", err)
+		}
+	}
+	return scanner.Err()
+}
+
+// handleServeRequest parses the options of the request and runs them.
+func handleServeRequest(line []byte) error {
+	request := &serveRequest{}
+	if err := json.Unmarshal(line, request); err != nil {
+		return fmt.Errorf("unmarshaling request: %w", err)
+	}
+	opts = options{}
+	if _, err := goflags.NewParser(&opts, goflags.PassDoubleDash).ParseArgs(request.Args); err != nil {
+		return fmt.Errorf("parsing arguments: %w", err)
+	}
+	if opts.Serve || opts.Watch {
+		return fmt.Errorf("--serve and --watch cannot be used in a request")
+	}
+	if opts.Data == stdioPath {
+		return fmt.Errorf("cannot read data from stdin in serve mode")
+	}
+	invalidateStaleFiles()
+	return run()
+}
@@ -0,0 +1,72 @@
+package main
+
+import "text/template"
+
+// renderState is the scratch space of a render, shared by all its templates so that they can coordinate.
+type renderState struct {
+	nameToOnceCache map[string]map[string]bool
+	nameToCounter   map[string]int
+	nameToVar       map[string]any
+}
+
+// newRenderState returns an empty render state.
+func newRenderState() *renderState {
+	return &renderState{
+		nameToOnceCache: map[string]map[string]bool{},
+		nameToCounter:   map[string]int{},
+		nameToVar:       map[string]any{},
+	}
+}
+
+// funcMap returns the template functions operating on the state.
+func (s *renderState) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"doOnce":       s.doOnce,
+		"doOnceIn":     s.doOnceIn,
+		"counter":      s.counter,
+		"counterValue": s.counterValue,
+		"setVar":       s.setVar,
+		"getVar":       s.getVar,
+	}
+}
+
+// doOnce returns true the first time it is called with the given key, and false afterwards.
+func (s *renderState) doOnce(key string) bool {
+	return s.doOnceIn("", key)
+}
+
+// doOnceIn is doOnce within the named cache, so that unrelated templates can use the same keys.
+func (s *renderState) doOnceIn(cache, key string) bool {
+	keyToDone, ok := s.nameToOnceCache[cache]
+	if !ok {
+		keyToDone = map[string]bool{}
+		s.nameToOnceCache[cache] = keyToDone
+	}
+	if keyToDone[key] {
+		return false // Already done.
+	}
+	keyToDone[key] = true
+	return true
+}
+
+// counter increments the named counter and returns its new value, starting at 1.
+func (s *renderState) counter(name string) int {
+	s.nameToCounter[name]++
+	return s.nameToCounter[name]
+}
+
+// counterValue returns the value of the named counter without incrementing it.
+func (s *renderState) counterValue(name string) int {
+	return s.nameToCounter[name]
+}
+
+// setVar sets the named variable. It returns an empty string so that it can be used in an action.
+func (s *renderState) setVar(name string, value any) string {
+	s.nameToVar[name] = value
+	return ""
+}
+
+// getVar returns the value of the named variable, or nil if it is not set.
+func (s *renderState) getVar(name string) any {
+	return s.nameToVar[name]
+}
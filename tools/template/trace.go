@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"text/template"
+)
+
+const (
+	// traceFuncName is the name of the function that instrumented templates call when they are executed.
+	traceFuncName = "traceTemplate"
+)
+
+// traceTemplate logs the execution of a template.
+func traceTemplate(name string) string {
+	log.Printf("Executing template %q", name)
+	return ""
+}
+
+// instrumentTemplates makes every template associated with the given template log its execution.
+// Parse trees are shared between clones, so each tree is copied before being instrumented.
+func instrumentTemplates(tmpl *template.Template) error {
+	for _, associatedTmpl := range tmpl.Templates() {
+		if associatedTmpl.Tree == nil || associatedTmpl.Tree.Root == nil {
+			continue
+		}
+		associatedTmpl.Tree = associatedTmpl.Tree.Copy()
+		name := associatedTmpl.Name()
+		traceTmpl, err := template.New("trace").Funcs(template.FuncMap{traceFuncName: traceTemplate}).Parse(
+			fmt.Sprintf("{{ %s %q }}", traceFuncName, name),
+		)
+		if err != nil {
+			return fmt.Errorf("instrumenting template %s: %w", name, err)
+		}
+		root := associatedTmpl.Tree.Root
+		root.Nodes = append(traceTmpl.Tree.Root.Nodes, root.Nodes...)
+	}
+	return nil
+}
+
+// traceMissingKey logs the first missing key of the template, with its location, by executing it again with missing
+// keys as errors. The functions with side effects or keeping state are replaced for this dry run, so that it doesn't
+// affect the render: commands are not executed, nothing is debugged, and seeded randomness comes from its own generator.
+func traceMissingKey(tmpl *template.Template, data map[string]any, output string) {
+	strictTmpl, err := tmpl.Clone()
+	if err != nil {
+		log.Warnf("Cloning template to trace missing keys of %s: %v", output, err)
+		return
+	}
+	funcMap := newRenderState().funcMap()
+	overrides, err := reproducibleFuncMap()
+	if err != nil {
+		log.Warnf("Tracing missing keys of %s: %v", output, err)
+		return
+	}
+	maps.Copy(funcMap, overrides)
+	funcMap["exec"] = func(string, ...string) (string, error) { return "", nil }
+	funcMap["debug"] = func(any) error { return nil }
+	funcMap[traceFuncName] = func(string) string { return "" }
+	strictTmpl.Funcs(funcMap).Option("missingkey=error")
+	if err := strictTmpl.Execute(io.Discard, data); err != nil {
+		log.Printf("Missing key in %s: %v", output, err)
+	}
+}
+
+// dumpData writes the data model to the given path as indented json.
+func dumpData(path string, data map[string]any) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// watchPollInterval is how often the inputs are checked for changes in watch mode.
+	watchPollInterval = 100 * time.Millisecond
+)
+
+// watchedPaths returns the input files of the given jobs.
+func watchedPaths(jobs []*renderJob) []string {
+	var paths []string
+	if opts.Data != "" {
+		paths = append(paths, opts.Data)
+	}
+	for _, job := range jobs {
+		// A pattern that doesn't match yet is not an error here: the file may not have been created yet.
+		templatePaths, _ := expandTemplatePaths(job.templatePaths)
+		paths = append(paths, templatePaths...)
+	}
+	return append(paths, includeDirPaths()...)
+}
+
+// includeDirPaths returns the files of the include directories.
+func includeDirPaths() []string {
+	var paths []string
+	for _, dir := range opts.IncludeDirs {
+		filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+	}
+	return paths
+}
+
+// snapshotModTimes returns the modification time of each path. Missing files are recorded with a zero time.
+func snapshotModTimes(paths []string) map[string]time.Time {
+	pathToModTime := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+		pathToModTime[path] = modTime
+	}
+	return pathToModTime
+}
+
+// watch calls fn, then calls it again every time the inputs of the jobs change. Changes are debounced so that a burst
+// of writes (e.g. an editor saving several files) triggers a single call. It never returns.
+func watch(jobs []*renderJob, fn func() error) {
+	renderAndLog := func() {
+		resetFileCaches()
+		if err := fn(); err != nil {
+			log.Errorf("rendering: %v", err)
+			return
+		}
+		log.Infof("Rendered %d output(s), watching for changes", len(jobs))
+	}
+
+	renderAndLog()
+	previous := snapshotModTimes(watchedPaths(jobs))
+	var changedAt time.Time
+	for range time.Tick(watchPollInterval) {
+		current := snapshotModTimes(watchedPaths(jobs))
+		if !maps.Equal(previous, current) {
+			previous = current
+			changedAt = time.Now()
+			continue
+		}
+		if !changedAt.IsZero() && time.Since(changedAt) >= opts.WatchDebounce {
+			changedAt = time.Time{}
+			renderAndLog()
+		}
+	}
+}
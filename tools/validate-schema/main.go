@@ -2,13 +2,12 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
 	"flag"
 	"log"
 	"os"
 
-	"github.com/xeipuuv/gojsonschema"
-	"gopkg.in/yaml.v3"
+	"github.com/malonaz/malonaz/tools/validate-schema/schema"
 )
 
 func main() {
@@ -25,7 +24,6 @@ func main() {
 	}
 
 	// Read the data file
-	data := map[string]any{}
 	dataBytes, err := os.ReadFile(*filePath)
 	if err != nil {
 		log.Fatalf("reading data file: %v", err)
@@ -34,45 +32,18 @@ func main() {
 	fixedDataBytes = bytes.ReplaceAll(fixedDataBytes, []byte("False"), []byte("false"))
 
 	// Unmarshal the data into a map
-	switch *format {
-	case "json":
-		if err := json.Unmarshal(fixedDataBytes, &data); err != nil {
-			log.Fatalf("unmarshaling json data: %v", err)
-		}
-	case "yaml":
-		if err := yaml.Unmarshal(fixedDataBytes, &data); err != nil {
-			log.Fatalf("unmarshaling yaml data: %v", err)
-		}
-	default:
-		log.Fatalf("unknown data format: %s", *format)
-	}
-
-	// Load schema
-	schemaBytes, err := os.ReadFile(*schemaPath)
+	data, err := schema.Unmarshal(fixedDataBytes, *format)
 	if err != nil {
-		log.Fatalf("reading schema file: %v", err)
-	}
-	schemaLoader := gojsonschema.NewStringLoader(string(schemaBytes))
-	schema, err := gojsonschema.NewSchema(schemaLoader)
-	if err != nil {
-		log.Fatalf("loading schema: %v", err)
+		log.Fatal(err)
 	}
 
-	// Convert data to JSON for validation
-	dataJSON, err := json.Marshal(data)
-	if err != nil {
-		log.Fatalf("marshaling data for validation: %v", err)
-	}
-
-	documentLoader := gojsonschema.NewStringLoader(string(dataJSON))
-	result, err := schema.Validate(documentLoader)
-	if err != nil {
-		log.Fatalf("validating data: %v", err)
-	}
-
-	if !result.Valid() {
+	if err := schema.Validate(*schemaPath, data); err != nil {
+		var validationError *schema.ValidationError
+		if !errors.As(err, &validationError) {
+			log.Fatal(err)
+		}
 		log.Println("Data validation failed:")
-		for _, desc := range result.Errors() {
+		for _, desc := range validationError.Errors {
 			log.Printf("- %s\n", desc)
 		}
 		log.Fatal("Data validation failed")
@@ -0,0 +1,75 @@
+// Package schema validates data documents against JSON schemas.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is returned when a document does not satisfy its schema.
+type ValidationError struct {
+	Errors []string
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return "data validation failed:\n- " + strings.Join(e.Errors, "\n- ")
+}
+
+// Unmarshal decodes the given bytes in the given format (json or yaml).
+func Unmarshal(bytes []byte, format string) (map[string]any, error) {
+	data := map[string]any{}
+	switch format {
+	case "json":
+		if err := json.Unmarshal(bytes, &data); err != nil {
+			return nil, fmt.Errorf("unmarshaling json data: %w", err)
+		}
+	case "yaml":
+		if err := yaml.Unmarshal(bytes, &data); err != nil {
+			return nil, fmt.Errorf("unmarshaling yaml data: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown data format: %s", format)
+	}
+	return data, nil
+}
+
+// Validate validates the data against the JSON schema at the given path.
+// It returns a *ValidationError if the data does not satisfy the schema.
+func Validate(schemaPath string, data any) error {
+	// Load schema
+	schemaBytes, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return fmt.Errorf("reading schema file: %w", err)
+	}
+	schemaLoader := gojsonschema.NewStringLoader(string(schemaBytes))
+	schema, err := gojsonschema.NewSchema(schemaLoader)
+	if err != nil {
+		return fmt.Errorf("loading schema: %w", err)
+	}
+
+	// Convert data to JSON for validation
+	dataJSON, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshaling data for validation: %w", err)
+	}
+
+	documentLoader := gojsonschema.NewStringLoader(string(dataJSON))
+	result, err := schema.Validate(documentLoader)
+	if err != nil {
+		return fmt.Errorf("validating data: %w", err)
+	}
+	if !result.Valid() {
+		validationError := &ValidationError{}
+		for _, desc := range result.Errors() {
+			validationError.Errors = append(validationError.Errors, desc.String())
+		}
+		return validationError
+	}
+	return nil
+}